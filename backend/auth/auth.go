@@ -0,0 +1,202 @@
+// Package auth handles account registration, login and the session
+// tokens used to identify which player a request is allowed to act as.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Service handles account registration, login and session validation
+// against the shared Redis client it's constructed with.
+type Service struct {
+	rdb *redis.Client
+}
+
+// New returns a Service backed by rdb.
+func New(rdb *redis.Client) *Service {
+	return &Service{rdb: rdb}
+}
+
+// sessionTTL is how long a login token stays valid in Redis.
+const sessionTTL = 24 * time.Hour
+
+var (
+	ErrUserExists         = errors.New("auth: user already exists")
+	ErrInvalidCredentials = errors.New("auth: invalid username or password")
+	ErrUnauthorized       = errors.New("auth: missing or invalid session token")
+)
+
+type contextKey string
+
+const userNameContextKey contextKey = "userName"
+
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+type credentials struct {
+	UserName string `json:"userName"`
+	Password string `json:"password"`
+}
+
+// Register handles POST /api/account/register.
+func (s *Service) Register(w http.ResponseWriter, r *http.Request) {
+	var body credentials
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+	if body.UserName == "" || body.Password == "" {
+		http.Error(w, "Missing userName or password", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+	userKey := "user:" + body.UserName
+
+	exists, err := s.rdb.Exists(ctx, userKey).Result()
+	if err != nil {
+		http.Error(w, "Failed to check existing user", http.StatusInternalServerError)
+		return
+	}
+	if exists > 0 {
+		http.Error(w, ErrUserExists.Error(), http.StatusConflict)
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.rdb.HSet(ctx, userKey, "passwordHash", string(passwordHash)).Err(); err != nil {
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// Login handles POST /api/account/login. On success it returns a session
+// token the client must send back as a Bearer token (or "token" query
+// param for the websocket upgrade).
+func (s *Service) Login(w http.ResponseWriter, r *http.Request) {
+	var body credentials
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	ctx := context.Background()
+
+	passwordHash, err := s.rdb.HGet(ctx, "user:"+body.UserName, "passwordHash").Result()
+	if errors.Is(err, redis.Nil) {
+		http.Error(w, ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to look up user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(body.Password)); err != nil {
+		http.Error(w, ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		http.Error(w, "Failed to generate session token", http.StatusInternalServerError)
+		return
+	}
+	if err := s.rdb.Set(ctx, "session:"+token, body.UserName, sessionTTL).Err(); err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Token string `json:"token"`
+	}{Token: token})
+}
+
+// Logout handles GET /api/account/logout and revokes the caller's
+// session token.
+func (s *Service) Logout(w http.ResponseWriter, r *http.Request) {
+	token := tokenFromRequest(r)
+	if token == "" {
+		http.Error(w, "Missing session token", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.rdb.Del(context.Background(), "session:"+token).Err(); err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func tokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	// Browsers can't set custom headers on the websocket upgrade request,
+	// so the token is allowed to travel as a query param there instead.
+	return r.URL.Query().Get("token")
+}
+
+func (s *Service) resolveUserName(r *http.Request) (string, error) {
+	token := tokenFromRequest(r)
+	if token == "" {
+		return "", ErrUnauthorized
+	}
+
+	userName, err := s.rdb.Get(context.Background(), "session:"+token).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrUnauthorized
+	}
+	if err != nil {
+		return "", err
+	}
+	return userName, nil
+}
+
+// UserName returns the authenticated userName that Middleware injected
+// into r's context.
+func UserName(r *http.Request) (string, bool) {
+	userName, ok := r.Context().Value(userNameContextKey).(string)
+	return userName, ok
+}
+
+// Middleware resolves the caller's session token to a userName and
+// injects it into the request context, rejecting the request if the
+// token is missing or invalid. Handlers should read the authenticated
+// identity via UserName instead of trusting a client-supplied userName.
+func (s *Service) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userName, err := s.resolveUserName(r)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userNameContextKey, userName)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
@@ -1,23 +1,174 @@
+// Package cardgenerator builds and deals the Exploding Kitten deck.
 package cardgenerator
 
-import (
-	"math/rand"
-	"time"
+import "math/rand"
+
+// CardType identifies what a Card does when it's drawn or played.
+type CardType string
+
+const (
+	CatCard             CardType = "cat"
+	DefuseCard          CardType = "defuse"
+	ShuffleCard         CardType = "shuffle"
+	ExplodingKittenCard CardType = "exploding_kitten"
+	AttackCard          CardType = "attack"
+	SkipCard            CardType = "skip"
+	SeeTheFutureCard    CardType = "see_the_future"
+	NopeCard            CardType = "nope"
+	FavorCard           CardType = "favor"
+	TacoCatCard         CardType = "taco_cat"
+)
+
+// Card is a single card in the deck.
+type Card struct {
+	Name string   `json:"name"`
+	Type CardType `json:"type"`
+}
+
+// Fixed counts for every non-bomb, non-defuse card in a standard deck.
+const (
+	numCatCards          = 4
+	numAttackCards       = 4
+	numSkipCards         = 4
+	numShuffleCards      = 4
+	numSeeTheFutureCards = 5
+	numNopeCards         = 5
+	numFavorCards        = 4
+	numTacoCatCards      = 4
+	numDefuseCards       = 6
 )
 
-var Characters = []string{
-	"Cat card 😼",
-	"Defuse card 🙅‍♂️",
-	"Shuffle card 🔀 ",
-	"Exploding kitten card 💣",
+func appendCards(deck []Card, n int, name string, t CardType) []Card {
+	for i := 0; i < n; i++ {
+		deck = append(deck, Card{Name: name, Type: t})
+	}
+	return deck
+}
+
+func shuffle(seed int64, deck []Card) []Card {
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(deck), func(i, j int) { deck[i], deck[j] = deck[j], deck[i] })
+	return deck
+}
+
+// numBombs returns how many Exploding Kitten cards a game of numPlayers
+// gets: one fewer than there are players.
+func numBombs(numPlayers int) int {
+	bombs := numPlayers - 1
+	if bombs < 0 {
+		bombs = 0
+	}
+	return bombs
+}
+
+// BuildSafeDeck constructs and shuffles every non-bomb card for a game of
+// numPlayers: a fixed count of every action card plus the defuse cards
+// left over once every player is dealt one. Starting hands should be
+// dealt from this bomb-free deck; InsertBombs then salts the leftovers
+// with the Exploding Kittens to form the draw pile.
+func BuildSafeDeck(numPlayers int, seed int64) []Card {
+	deck := make([]Card, 0, 64)
+	deck = appendCards(deck, numCatCards, "Cat card 😼", CatCard)
+	deck = appendCards(deck, numAttackCards, "Attack card 💥", AttackCard)
+	deck = appendCards(deck, numSkipCards, "Skip card ⏭️", SkipCard)
+	deck = appendCards(deck, numShuffleCards, "Shuffle card 🔀", ShuffleCard)
+	deck = appendCards(deck, numSeeTheFutureCards, "See the Future card 🔮", SeeTheFutureCard)
+	deck = appendCards(deck, numNopeCards, "Nope card 🙅", NopeCard)
+	deck = appendCards(deck, numFavorCards, "Favor card 🎁", FavorCard)
+	deck = appendCards(deck, numTacoCatCards, "Taco Cat card 🌮", TacoCatCard)
+
+	remainingDefuses := numDefuseCards - numPlayers
+	if remainingDefuses < 0 {
+		remainingDefuses = 0
+	}
+	deck = appendCards(deck, remainingDefuses, "Defuse card 🙅‍♂️", DefuseCard)
+
+	return shuffle(seed, deck)
+}
+
+// InsertBombs shuffles numPlayers-1 Exploding Kitten cards into deck,
+// turning the leftovers of a BuildSafeDeck into a full draw pile. It's a
+// separate step from dealing so starting hands never contain a bomb.
+func InsertBombs(deck []Card, numPlayers int, seed int64) []Card {
+	deck = appendCards(deck, numBombs(numPlayers), "Exploding kitten card 💣", ExplodingKittenCard)
+	return shuffle(seed, deck)
+}
+
+// BuildDeck constructs the full shuffled draw pile for a game of
+// numPlayers: one bomb fewer than there are players, a fixed count of
+// every action card, and the defuse cards left over once every player is
+// dealt one. Callers that deal starting hands before drawing should build
+// from BuildSafeDeck and InsertBombs instead, so dealt hands stay bomb-free.
+func BuildDeck(numPlayers int, seed int64) []Card {
+	return InsertBombs(BuildSafeDeck(numPlayers, seed), numPlayers, seed)
+}
+
+// Deck is a drawable, reproducible stack of Cards.
+type Deck struct {
+	seed  int64
+	cards []Card
+}
+
+// DeckFromSeed builds a two-player deck from seed. Callers that know the
+// real player count should build their own deck with BuildDeck and wrap
+// it, e.g. via NewDeck.
+func DeckFromSeed(seed int64) *Deck {
+	return NewDeck(seed, BuildDeck(2, seed))
+}
+
+// NewDeck wraps an already-built set of cards so it can be drawn from.
+func NewDeck(seed int64, cards []Card) *Deck {
+	return &Deck{seed: seed, cards: cards}
+}
+
+// Draw removes and returns the top card. ok is false if the deck is empty.
+func (d *Deck) Draw() (card Card, ok bool) {
+	if len(d.cards) == 0 {
+		return Card{}, false
+	}
+	card = d.cards[0]
+	d.cards = d.cards[1:]
+	return card, true
+}
+
+// Peek returns (without removing) the top n cards, for the See the
+// Future card. n is clamped to the deck's length.
+func (d *Deck) Peek(n int) []Card {
+	if n > len(d.cards) {
+		n = len(d.cards)
+	}
+	peeked := make([]Card, n)
+	copy(peeked, d.cards[:n])
+	return peeked
+}
+
+// Shuffle re-shuffles the remaining cards using the deck's seed.
+func (d *Deck) Shuffle() {
+	r := rand.New(rand.NewSource(d.seed))
+	r.Shuffle(len(d.cards), func(i, j int) { d.cards[i], d.cards[j] = d.cards[j], d.cards[i] })
 }
 
-func GenerateRandomCards() []string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	randomDeck := make([]string, 5)
-	for i := 0; i < 5; i++ {
-		index := r.Intn(4)
-		randomDeck[i] = Characters[index]
+// InsertBombAt places an exploding kitten card at pos cards from the top,
+// for a player who defused one back into the deck. pos is clamped to the
+// deck's bounds.
+func (d *Deck) InsertBombAt(pos int) {
+	if pos < 0 {
+		pos = 0
 	}
-	return randomDeck
+	if pos > len(d.cards) {
+		pos = len(d.cards)
+	}
+	bomb := Card{Name: "Exploding kitten card 💣", Type: ExplodingKittenCard}
+	d.cards = append(d.cards[:pos:pos], append([]Card{bomb}, d.cards[pos:]...)...)
+}
+
+// Len returns the number of cards left in the deck.
+func (d *Deck) Len() int {
+	return len(d.cards)
+}
+
+// Cards returns the deck's remaining cards, for persisting its state back
+// to the caller's store.
+func (d *Deck) Cards() []Card {
+	return d.cards
 }
@@ -0,0 +1,93 @@
+package cardgenerator
+
+import "testing"
+
+func countByType(cards []Card, t CardType) int {
+	n := 0
+	for _, c := range cards {
+		if c.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBuildSafeDeckHasNoBombs(t *testing.T) {
+	deck := BuildSafeDeck(4, 42)
+
+	if n := countByType(deck, ExplodingKittenCard); n != 0 {
+		t.Fatalf("BuildSafeDeck(4, 42) contains %d bombs, want 0", n)
+	}
+}
+
+func TestBuildSafeDeckDefuseCount(t *testing.T) {
+	deck := BuildSafeDeck(4, 42)
+
+	want := numDefuseCards - 4
+	if n := countByType(deck, DefuseCard); n != want {
+		t.Fatalf("BuildSafeDeck(4, 42) has %d defuse cards, want %d", n, want)
+	}
+}
+
+func TestInsertBombsAddsCorrectCount(t *testing.T) {
+	safe := BuildSafeDeck(4, 42)
+	deck := InsertBombs(safe, 4, 42)
+
+	if n := countByType(deck, ExplodingKittenCard); n != numBombs(4) {
+		t.Fatalf("InsertBombs(_, 4, 42) has %d bombs, want %d", n, numBombs(4))
+	}
+	if len(deck) != len(safe)+numBombs(4) {
+		t.Fatalf("InsertBombs(_, 4, 42) has %d cards, want %d", len(deck), len(safe)+numBombs(4))
+	}
+}
+
+func TestBuildDeckDeterministicForSameSeed(t *testing.T) {
+	a := BuildDeck(4, 42)
+	b := BuildDeck(4, 42)
+
+	if len(a) != len(b) {
+		t.Fatalf("decks have different lengths: %d vs %d", len(a), len(b))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("decks diverge at index %d: %v vs %v", i, a[i], b[i])
+		}
+	}
+}
+
+func TestDeckDrawPeekShuffleInsertBomb(t *testing.T) {
+	cards := []Card{
+		{Name: "a", Type: CatCard},
+		{Name: "b", Type: CatCard},
+		{Name: "c", Type: CatCard},
+	}
+	d := NewDeck(42, cards)
+
+	if peeked := d.Peek(2); len(peeked) != 2 || peeked[0].Name != "a" || peeked[1].Name != "b" {
+		t.Fatalf("Peek(2) = %v, want top two cards unchanged", peeked)
+	}
+	if d.Len() != 3 {
+		t.Fatalf("Peek must not remove cards, Len() = %d, want 3", d.Len())
+	}
+
+	d.InsertBombAt(1)
+	if d.Len() != 4 {
+		t.Fatalf("after InsertBombAt, Len() = %d, want 4", d.Len())
+	}
+	if d.Cards()[1].Type != ExplodingKittenCard {
+		t.Fatalf("InsertBombAt(1) did not place the bomb at index 1: %v", d.Cards())
+	}
+
+	card, ok := d.Draw()
+	if !ok || card.Name != "a" {
+		t.Fatalf("Draw() = %v, %v, want top card %q", card, ok, "a")
+	}
+	if d.Len() != 3 {
+		t.Fatalf("after Draw, Len() = %d, want 3", d.Len())
+	}
+
+	empty := NewDeck(42, nil)
+	if _, ok := empty.Draw(); ok {
+		t.Fatalf("Draw() on an empty deck returned ok = true")
+	}
+}
@@ -0,0 +1,225 @@
+// Package engine holds the server-authoritative game rules. It owns the
+// deck and score for each player so that the client can only ever ask
+// the server to draw a card or play a defuse instead of POSTing its own
+// idea of the game state.
+package engine
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	l "backend/cardgenerator"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrScoreMismatch is returned when a client's reported score does not
+// match what the server has recorded for that player.
+var ErrScoreMismatch = errors.New("engine: client score does not match server state")
+
+// ErrNoDefuseCard is returned when a player tries to play a defuse card
+// they don't have.
+var ErrNoDefuseCard = errors.New("engine: no defuse card available")
+
+// ErrDeckEmpty is returned when DrawCard is called on an empty deck.
+var ErrDeckEmpty = errors.New("engine: no cards left to draw")
+
+// GameState is the server's view of a single player's game.
+type GameState struct {
+	Score         int      `json:"score"`
+	GameCards     []l.Card `json:"gameCards"`
+	HasDefuseCard bool     `json:"hasDefuseCard"`
+	Exploded      bool     `json:"exploded"`
+	Seed          int64    `json:"seed"`
+}
+
+// Engine applies the Exploding Kitten rules against the game state stored
+// in Redis for each player.
+type Engine struct {
+	rdb *redis.Client
+}
+
+// New returns an Engine backed by rdb.
+func New(rdb *redis.Client) *Engine {
+	return &Engine{rdb: rdb}
+}
+
+func newSeed() int64 {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.BigEndian.Uint64(buf))
+}
+
+// randIndex returns a random int in [0, n). It falls back to 0 if the
+// system RNG is unavailable (newSeed falls back to the clock instead).
+func randIndex(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(buf) % uint64(n))
+}
+
+func (e *Engine) loadState(ctx context.Context, userName string) (GameState, error) {
+	gameDataMap, err := e.rdb.HGetAll(ctx, userName).Result()
+	if err != nil {
+		return GameState{}, err
+	}
+
+	state := GameState{}
+	state.Score, _ = strconv.Atoi(gameDataMap["score"])
+	json.Unmarshal([]byte(gameDataMap["gameCards"]), &state.GameCards)
+	state.HasDefuseCard, _ = strconv.ParseBool(gameDataMap["hasDefuseCard"])
+	state.Seed, _ = strconv.ParseInt(gameDataMap["deckSeed"], 10, 64)
+	return state, nil
+}
+
+func (e *Engine) saveState(ctx context.Context, userName string, state GameState) error {
+	gameCardsJSON, err := json.Marshal(state.GameCards)
+	if err != nil {
+		return err
+	}
+
+	return e.rdb.HMSet(ctx, userName,
+		"gameCards", string(gameCardsJSON),
+		"hasDefuseCard", state.HasDefuseCard,
+		"score", state.Score,
+		"deckSeed", state.Seed,
+	).Err()
+}
+
+func (e *Engine) updateLeaderboard(ctx context.Context, userName string, score int) error {
+	return e.rdb.ZAdd(ctx, "leaderboard", &redis.Z{Score: float64(score), Member: userName}).Err()
+}
+
+// DrawCard draws the top card of userName's deck, applies its effect and
+// persists the resulting state. It returns the drawn card alongside the
+// resulting GameState.
+func (e *Engine) DrawCard(userName string) (l.Card, GameState, error) {
+	ctx := context.Background()
+
+	state, err := e.loadState(ctx, userName)
+	if err != nil {
+		return l.Card{}, GameState{}, err
+	}
+
+	deck := l.NewDeck(state.Seed, state.GameCards)
+	card, ok := deck.Draw()
+	if !ok {
+		return l.Card{}, state, ErrDeckEmpty
+	}
+
+	switch card.Type {
+	case l.ExplodingKittenCard:
+		if state.HasDefuseCard {
+			// A played defuse puts the bomb back into the deck at random,
+			// rather than discarding it, matching the real game's rules.
+			state.HasDefuseCard = false
+			deck.InsertBombAt(randIndex(deck.Len() + 1))
+		} else {
+			state.Exploded = true
+			state.Score = 0
+		}
+	case l.DefuseCard:
+		state.HasDefuseCard = true
+		state.Score++
+	case l.ShuffleCard:
+		deck.Shuffle()
+		state.Score++
+	default:
+		state.Score++
+	}
+
+	state.GameCards = deck.Cards()
+	if err := e.saveState(ctx, userName, state); err != nil {
+		return l.Card{}, GameState{}, err
+	}
+	if err := e.updateLeaderboard(ctx, userName, state.Score); err != nil {
+		return l.Card{}, GameState{}, err
+	}
+
+	return card, state, nil
+}
+
+// PeekCards returns the top n cards of userName's deck without drawing
+// them, for the "See the Future" card's effect.
+func (e *Engine) PeekCards(userName string, n int) ([]l.Card, error) {
+	state, err := e.loadState(context.Background(), userName)
+	if err != nil {
+		return nil, err
+	}
+	return l.NewDeck(state.Seed, state.GameCards).Peek(n), nil
+}
+
+// PlayDefuse consumes userName's defuse card. It fails if the player
+// doesn't currently hold one.
+func (e *Engine) PlayDefuse(userName string) (GameState, error) {
+	ctx := context.Background()
+
+	state, err := e.loadState(ctx, userName)
+	if err != nil {
+		return GameState{}, err
+	}
+	if !state.HasDefuseCard {
+		return state, ErrNoDefuseCard
+	}
+
+	state.HasDefuseCard = false
+	if err := e.saveState(ctx, userName, state); err != nil {
+		return GameState{}, err
+	}
+
+	return state, nil
+}
+
+// ResetDeck deals userName a fresh, freshly-seeded deck and resets their
+// score. The seed is persisted alongside the deck so the same deal can be
+// reproduced later.
+func (e *Engine) ResetDeck(userName string) (GameState, error) {
+	ctx := context.Background()
+
+	seed := newSeed()
+	state := GameState{
+		GameCards: l.DeckFromSeed(seed).Cards(),
+		Seed:      seed,
+	}
+	if err := e.saveState(ctx, userName, state); err != nil {
+		return GameState{}, err
+	}
+	if err := e.updateLeaderboard(ctx, userName, state.Score); err != nil {
+		return GameState{}, err
+	}
+
+	return state, nil
+}
+
+// ValidateScore returns ErrScoreMismatch if clientScore doesn't match the
+// score the server has recorded for userName.
+func (e *Engine) ValidateScore(userName string, clientScore int) error {
+	ctx := context.Background()
+
+	state, err := e.loadState(ctx, userName)
+	if err != nil {
+		return err
+	}
+	if state.Score != clientScore {
+		return ErrScoreMismatch
+	}
+	return nil
+}
+
+// State returns the server's current view of userName's game, so callers
+// can't be tricked into trusting a client-supplied deck or defuse flag.
+func (e *Engine) State(userName string) (GameState, error) {
+	return e.loadState(context.Background(), userName)
+}
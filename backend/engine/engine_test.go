@@ -0,0 +1,21 @@
+package engine
+
+import "testing"
+
+func TestRandIndexInRange(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		n := randIndex(5)
+		if n < 0 || n >= 5 {
+			t.Fatalf("randIndex(5) = %d, want [0, 5)", n)
+		}
+	}
+}
+
+func TestRandIndexZeroForNonPositiveN(t *testing.T) {
+	if n := randIndex(0); n != 0 {
+		t.Fatalf("randIndex(0) = %d, want 0", n)
+	}
+	if n := randIndex(-1); n != 0 {
+		t.Fatalf("randIndex(-1) = %d, want 0", n)
+	}
+}
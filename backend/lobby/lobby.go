@@ -0,0 +1,495 @@
+package lobby
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"backend/auth"
+	l "backend/cardgenerator"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// handSize is the number of cards dealt to a player when they join a
+// lobby. defaultLobbyPlayers is the bomb/defuse-accurate player count used
+// when the host doesn't say how many players they expect.
+const (
+	handSize            = 5
+	defaultLobbyPlayers = 4
+)
+
+var rdb *redis.Client
+
+var upgrader = websocket.Upgrader{}
+
+// Player is a single participant of a Game.
+type Player struct {
+	UserName string `json:"userName"`
+	conn     *websocket.Conn
+}
+
+type playerAction struct {
+	UserName string          `json:"userName"`
+	Type     string          `json:"type"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// Game owns the state for a single lobby. All mutation happens on the
+// goroutine started by run(), the register/unregister/action/resetDeck/stop
+// channels are the only way in.
+type Game struct {
+	ID         string
+	Passphrase string
+
+	register   chan *Player
+	unregister chan string
+	action     chan playerAction
+	resetDeck  chan int64
+	stop       chan struct{}
+
+	numPlayers int
+	seed       int64
+	hands      *l.Deck // bomb-free cards dealt out as starting hands
+	deck       *l.Deck // draw pile: hands' leftovers salted with bombs
+
+	mu        sync.RWMutex // guards the fields below, published by run() after each mutation
+	players   map[string]*Player
+	gameCards map[string][]l.Card
+}
+
+func newSeed() int64 {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(buf))
+}
+
+// buildDecks deals numPlayers starting hands off a bomb-free sub-deck and
+// only then salts the leftovers with Exploding Kittens to form the draw
+// pile, so the first numPlayers starting hands never contain a bomb.
+func buildDecks(numPlayers int, seed int64) (hands, deck *l.Deck) {
+	safe := l.BuildSafeDeck(numPlayers, seed)
+
+	dealt := numPlayers * handSize
+	if dealt > len(safe) {
+		dealt = len(safe)
+	}
+
+	hands = l.NewDeck(seed, safe[:dealt:dealt])
+	deck = l.NewDeck(seed, l.InsertBombs(safe[dealt:], numPlayers, seed))
+	return hands, deck
+}
+
+// newGame seeds a fresh deck sized for numPlayers, so the bomb/defuse
+// count matches the lobby the host actually asked for instead of a guess
+// made before anyone has joined.
+func newGame(id, passphrase string, numPlayers int) *Game {
+	seed := newSeed()
+	hands, deck := buildDecks(numPlayers, seed)
+	return &Game{
+		ID:         id,
+		Passphrase: passphrase,
+		register:   make(chan *Player),
+		unregister: make(chan string),
+		action:     make(chan playerAction),
+		resetDeck:  make(chan int64),
+		stop:       make(chan struct{}),
+		numPlayers: numPlayers,
+		seed:       seed,
+		hands:      hands,
+		deck:       deck,
+		players:    make(map[string]*Player),
+		gameCards:  make(map[string][]l.Card),
+	}
+}
+
+// deal draws a starting hand for userName off the bomb-free hand pool,
+// falling back to the draw pile if more players join than the lobby was
+// sized for. Callers must hold g.mu.
+func (g *Game) deal(userName string) {
+	hand := make([]l.Card, 0, handSize)
+	for i := 0; i < handSize; i++ {
+		card, ok := g.hands.Draw()
+		if !ok {
+			card, ok = g.deck.Draw()
+		}
+		if !ok {
+			break
+		}
+		hand = append(hand, card)
+	}
+	g.gameCards[userName] = hand
+}
+
+func (g *Game) run() {
+	for {
+		select {
+		case p := <-g.register:
+			g.mu.Lock()
+			if existing, ok := g.players[p.UserName]; ok && existing.conn != nil && p.conn != nil {
+				// A second live connection for the same player must not
+				// tear down the first one out from under them - reject
+				// it, mirroring ws.Hub.Run's duplicate-connection handling.
+				g.mu.Unlock()
+				log.Printf("lobby: rejecting duplicate connection for %q", p.UserName)
+				p.conn.Close()
+				continue
+			}
+			g.players[p.UserName] = p
+			if _, ok := g.gameCards[p.UserName]; !ok {
+				g.deal(p.UserName)
+			}
+			g.mu.Unlock()
+			g.broadcastState()
+
+		case userName := <-g.unregister:
+			g.mu.Lock()
+			if p, ok := g.players[userName]; ok {
+				if p.conn != nil {
+					p.conn.Close()
+				}
+				delete(g.players, userName)
+			}
+			g.mu.Unlock()
+			g.broadcastState()
+
+		case act := <-g.action:
+			g.handleAction(act)
+			g.broadcastState()
+
+		case seed := <-g.resetDeck:
+			g.mu.Lock()
+			g.seed = seed
+			g.hands, g.deck = buildDecks(g.numPlayers, seed)
+			g.gameCards = make(map[string][]l.Card)
+			for userName := range g.players {
+				g.deal(userName)
+			}
+			g.mu.Unlock()
+			g.broadcastState()
+
+		case <-g.stop:
+			g.mu.Lock()
+			for _, p := range g.players {
+				if p.conn != nil {
+					p.conn.Close()
+				}
+			}
+			g.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (g *Game) handleAction(act playerAction) {
+	ctx := context.Background()
+
+	switch act.Type {
+	case "score":
+		var score int
+		if err := json.Unmarshal(act.Payload, &score); err != nil {
+			log.Println("lobby: bad score payload:", err)
+			return
+		}
+		if err := rdb.ZAdd(ctx, "leaderboard:"+g.ID, &redis.Z{Score: float64(score), Member: act.UserName}).Err(); err != nil {
+			log.Println("lobby: failed to update leaderboard:", err)
+		}
+	default:
+		log.Println("lobby: unknown action type:", act.Type)
+	}
+}
+
+// snapshot is the JSON-serializable view of a Game returned by the HTTP API.
+type snapshot struct {
+	ID      string   `json:"id"`
+	Players []string `json:"players"`
+}
+
+func (g *Game) snapshot() snapshot {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	players := make([]string, 0, len(g.players))
+	for name := range g.players {
+		players = append(players, name)
+	}
+	return snapshot{ID: g.ID, Players: players}
+}
+
+func (g *Game) broadcastState() {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	data, err := json.Marshal(g.snapshot())
+	if err != nil {
+		log.Println("lobby: failed to marshal game state:", err)
+		return
+	}
+	for _, p := range g.players {
+		if p.conn == nil {
+			continue
+		}
+		if err := p.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			log.Println("lobby: failed to broadcast to player:", err)
+		}
+	}
+}
+
+// Controller owns every active Game, keyed by lobby id.
+type Controller struct {
+	auth *auth.Service
+
+	mu    sync.RWMutex
+	games map[string]*Game
+}
+
+// NewController returns an empty Controller ready to serve HTTP routes,
+// sharing sharedRDB and authSvc with the rest of the server instead of
+// standing up its own Redis connection.
+func NewController(sharedRDB *redis.Client, authSvc *auth.Service) *Controller {
+	rdb = sharedRDB
+	return &Controller{auth: authSvc, games: make(map[string]*Game)}
+}
+
+func generateID(nBytes int) (string, error) {
+	buf := make([]byte, nBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// StartGame handles POST /games?numPlayers=N. It creates a new lobby sized
+// for the host's expected player count (defaulting to defaultLobbyPlayers
+// if omitted), starts its goroutine and returns the generated id and
+// passphrase.
+func (c *Controller) StartGame(w http.ResponseWriter, r *http.Request) {
+	numPlayers := defaultLobbyPlayers
+	if v := r.URL.Query().Get("numPlayers"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid numPlayers", http.StatusBadRequest)
+			return
+		}
+		numPlayers = n
+	}
+
+	id, err := generateID(4)
+	if err != nil {
+		http.Error(w, "Failed to generate lobby id", http.StatusInternalServerError)
+		return
+	}
+	passphrase, err := generateID(3)
+	if err != nil {
+		http.Error(w, "Failed to generate lobby passphrase", http.StatusInternalServerError)
+		return
+	}
+
+	game := newGame(id, passphrase, numPlayers)
+	go game.run()
+
+	c.mu.Lock()
+	c.games[id] = game
+	c.mu.Unlock()
+
+	// Persist the seed so a reset can reproduce this lobby's deck.
+	if err := rdb.Set(context.Background(), "deckSeed:"+id, game.seed, 0).Err(); err != nil {
+		log.Println("lobby: failed to persist deck seed:", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ID         string `json:"id"`
+		Passphrase string `json:"passphrase"`
+	}{ID: id, Passphrase: passphrase})
+}
+
+// ListGames handles GET /games and returns the ids of every active lobby.
+func (c *Controller) ListGames(w http.ResponseWriter, r *http.Request) {
+	c.mu.RLock()
+	ids := make([]string, 0, len(c.games))
+	for id := range c.games {
+		ids = append(ids, id)
+	}
+	c.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ids)
+}
+
+func (c *Controller) lookupGame(r *http.Request) (*Game, bool) {
+	id := mux.Vars(r)["id"]
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	game, ok := c.games[id]
+	return game, ok
+}
+
+// GetGame handles GET /games/{id} and returns the lobby state and players.
+func (c *Controller) GetGame(w http.ResponseWriter, r *http.Request) {
+	game, ok := c.lookupGame(r)
+	if !ok {
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(game.snapshot())
+}
+
+// JoinGame handles POST /games/{id}/join, and GET for a websocket upgrade.
+// If a websocket upgrade is requested the connection is registered with
+// the game so the player receives broadcast updates.
+func (c *Controller) JoinGame(w http.ResponseWriter, r *http.Request) {
+	game, ok := c.lookupGame(r)
+	if !ok {
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		return
+	}
+
+	// Identify the player from their session, never from the query param
+	userName, _ := auth.UserName(r)
+	if userName == "" {
+		http.Error(w, "Missing userName", http.StatusBadRequest)
+		return
+	}
+
+	player := &Player{UserName: userName}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("lobby: error upgrading to WebSocket:", err)
+			return
+		}
+		player.conn = conn
+	}
+
+	select {
+	case game.register <- player:
+	case <-game.stop:
+		if player.conn != nil {
+			player.conn.Close()
+		}
+		http.Error(w, "Lobby has been stopped", http.StatusGone)
+		return
+	}
+
+	if player.conn == nil {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(game.snapshot())
+	}
+}
+
+// SubmitAction handles POST /games/{id}/action. It decodes a playerAction
+// from the body and hands it to the lobby's run loop — e.g. a "score"
+// action, which is how a player's result lands on the per-lobby
+// leaderboard. The acting player is always the caller's session, never
+// whatever userName the request body claims.
+func (c *Controller) SubmitAction(w http.ResponseWriter, r *http.Request) {
+	game, ok := c.lookupGame(r)
+	if !ok {
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		return
+	}
+
+	var act playerAction
+	if err := json.NewDecoder(r.Body).Decode(&act); err != nil {
+		http.Error(w, "Failed to decode request body", http.StatusBadRequest)
+		return
+	}
+
+	userName, _ := auth.UserName(r)
+	if userName == "" {
+		http.Error(w, "Missing userName", http.StatusBadRequest)
+		return
+	}
+	act.UserName = userName
+
+	select {
+	case game.action <- act:
+	case <-game.stop:
+		http.Error(w, "Lobby has been stopped", http.StatusGone)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ResetGame handles POST /games/{id}/reset. It rebuilds the lobby's deck
+// from the seed persisted at creation time and re-deals every connected
+// player's hand, so a reset reproduces the original deal instead of
+// dealing a brand new one.
+func (c *Controller) ResetGame(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	game, ok := c.lookupGame(r)
+	if !ok {
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		return
+	}
+
+	seedStr, err := rdb.Get(context.Background(), "deckSeed:"+id).Result()
+	if err != nil {
+		http.Error(w, "Failed to load deck seed", http.StatusInternalServerError)
+		return
+	}
+	seed, err := strconv.ParseInt(seedStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Corrupt deck seed", http.StatusInternalServerError)
+		return
+	}
+
+	select {
+	case game.resetDeck <- seed:
+	case <-game.stop:
+		http.Error(w, "Lobby has been stopped", http.StatusGone)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(game.snapshot())
+}
+
+// StopGame handles DELETE /games/{id}. It stops the game's goroutine and
+// removes it from the controller.
+func (c *Controller) StopGame(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	c.mu.Lock()
+	game, ok := c.games[id]
+	if ok {
+		delete(c.games, id)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "Lobby not found", http.StatusNotFound)
+		return
+	}
+
+	close(game.stop)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegisterRoutes wires the lobby HTTP API onto r, requiring a valid
+// session on every route — the same anti-cheat guarantee chunk0-5 gives
+// the single-player /game endpoints.
+func (c *Controller) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/games", c.auth.Middleware(c.StartGame)).Methods("POST")
+	r.HandleFunc("/games", c.auth.Middleware(c.ListGames)).Methods("GET")
+	r.HandleFunc("/games/{id}", c.auth.Middleware(c.GetGame)).Methods("GET")
+	r.HandleFunc("/games/{id}/join", c.auth.Middleware(c.JoinGame)).Methods("POST", "GET")
+	r.HandleFunc("/games/{id}/action", c.auth.Middleware(c.SubmitAction)).Methods("POST")
+	r.HandleFunc("/games/{id}/reset", c.auth.Middleware(c.ResetGame)).Methods("POST")
+	r.HandleFunc("/games/{id}", c.auth.Middleware(c.StopGame)).Methods("DELETE")
+}
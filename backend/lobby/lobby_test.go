@@ -0,0 +1,36 @@
+package lobby
+
+import "testing"
+
+func TestBuildDecksDealsBombFreeHands(t *testing.T) {
+	numPlayers := 4
+	hands, deck := buildDecks(numPlayers, 42)
+
+	dealt := numPlayers * handSize
+	for i := 0; i < dealt; i++ {
+		card, ok := hands.Draw()
+		if !ok {
+			t.Fatalf("hands ran out after %d cards, want at least %d", i, dealt)
+		}
+		if card.Type == "exploding_kitten" {
+			t.Fatalf("card %d dealt to a starting hand is a bomb: %v", i, card)
+		}
+	}
+	if _, ok := hands.Draw(); ok {
+		t.Fatal("hands pool has cards left over after dealing every starting hand")
+	}
+
+	bombs := 0
+	for {
+		card, ok := deck.Draw()
+		if !ok {
+			break
+		}
+		if card.Type == "exploding_kitten" {
+			bombs++
+		}
+	}
+	if want := numPlayers - 1; bombs != want {
+		t.Fatalf("draw pile has %d bombs, want %d", bombs, want)
+	}
+}
@@ -3,21 +3,27 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"sync"
 
+	"backend/auth"
 	l "backend/cardgenerator"
+	"backend/engine"
+	"backend/lobby"
+	"backend/ws"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
 )
 
 var (
-	rdb *redis.Client
+	rdb        *redis.Client
+	gameEngine *engine.Engine
+	authSvc    *auth.Service
 )
 
 func init() {
@@ -26,6 +32,11 @@ func init() {
 		Password: "",
 		DB:       0,
 	})
+	gameEngine = engine.New(rdb)
+	authSvc = auth.New(rdb)
+	hub.OnMessage = func(userName string, _ []byte) {
+		updateLeaderboard(userName)
+	}
 }
 
 type LeaderboardEntry struct {
@@ -45,7 +56,7 @@ type Card struct {
 	Type string `json:"type"`
 }
 
-var broadcastLeaderboard = make(chan []byte)
+var hub = ws.NewHub()
 
 func getLatestLeaderboard() ([]LeaderboardEntry, error) {
 	ctx := context.Background()
@@ -70,74 +81,49 @@ func getLatestLeaderboard() ([]LeaderboardEntry, error) {
 }
 
 var (
-	upgrader       = websocket.Upgrader{}
 	leaderboardMap = make(map[string]int)
 	mu             sync.Mutex
 )
 
+// websocketHandler upgrades the connection to a websocket and hands it to
+// the hub, keyed by the authenticated userName so a reconnecting browser
+// is recognized instead of spawning an unrelated duplicate client.
 func websocketHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	userName, _ := auth.UserName(r)
 
-	if err != nil {
+	if err := hub.ServeWS(w, r, userName); err != nil {
 		log.Println("Error upgrading to WebSocket:", err)
 		return
 	}
-	defer conn.Close()
-
-	log.Println("WebSocket connection established")
-
-	for {
-		// read message from the client
-		messageType, message, err := conn.ReadMessage()
-
-		if err != nil {
-			log.Println("Error reading message:", err)
-			break
-		}
-
-		log.Printf("Received message: %s", message)
-
-		// Update leaderboard
-		updateLeaderboard(string(message))
-
-		// Get the latest leaderboard
-		leaderboard, err := getLatestLeaderboard()
-		if err != nil {
-			log.Println("Error fetching latest leaderboard:", err)
-			continue
-		}
 
-		// Emit the latest leaderboard to all connected clients
-		emitLeaderboard(conn, leaderboard, messageType)
-
-	}
+	log.Println("WebSocket connection established for", userName)
 }
 
+// updateLeaderboard bumps userName's in-memory tally and publishes the
+// latest Redis leaderboard to every connected client via the hub.
 func updateLeaderboard(userName string) {
 	mu.Lock()
-	defer mu.Unlock()
-
-	// Increment the score of the user
 	leaderboardMap[userName]++
-}
+	mu.Unlock()
+
+	leaderboard, err := getLatestLeaderboard()
+	if err != nil {
+		log.Println("Error fetching latest leaderboard:", err)
+		return
+	}
 
-func emitLeaderboard(conn *websocket.Conn, leaderboard []LeaderboardEntry, messageType int) {
-	// Serialize the leaderboard to JSON
 	leaderboardJSON, err := json.Marshal(leaderboard)
 	if err != nil {
 		log.Println("Error serializing leaderboard:", err)
 		return
 	}
 
-	// Send the serialized  leaderboard to the client
-	if err := conn.WriteMessage(messageType, leaderboardJSON); err != nil {
-		log.Println("Error writing leaderboard:", err)
-	}
+	hub.Broadcast <- leaderboardJSON
 }
 
 func gameHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse query parameters
-	userName := r.URL.Query().Get("userName")
+	// Identify the player from their session, never from the query param
+	userName, _ := auth.UserName(r)
 
 	// Check if the user exists
 	ctx := context.Background()
@@ -150,22 +136,10 @@ func gameHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Initialize game data for new users
 	if isMember == 0 && userName != "" {
-		randomCards := l.GenerateRandomCards()
-		randomCardsJSON, err := json.Marshal(randomCards)
-		if err != nil {
-			http.Error(w, "Failed to initialize game data", http.StatusInternalServerError)
-		}
-		_, err = rdb.HMSet(ctx, userName, map[string]interface{}{
-			"score":         0,
-			"gameCards":     randomCardsJSON,
-			"hasDefuseCard": false,
-			"activeCard":    nil,
-		}).Result()
-		if err != nil {
+		if _, err := gameEngine.ResetDeck(userName); err != nil {
 			http.Error(w, "Failed to initiate game for new user", http.StatusInternalServerError)
 			return
 		}
-		rdb.ZAdd(ctx, "leaderboard", &redis.Z{Score: 0, Member: userName})
 	}
 
 	// Retrieve game data for the user
@@ -204,6 +178,13 @@ func gameHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(responseData)
 }
 
+// updateGameData is a compatibility shim for clients that still speak the
+// old free-form PUT protocol. The game rules now live in gameEngine, which
+// owns the deck and defuse flag, so this handler only ever accepts
+// activeCard from the client and rejects the request if the client-supplied
+// score disagrees with the server's — gameCards and hasDefuseCard are never
+// taken from the request body, or a client could PUT a forged deck and have
+// it honored by the next /game/draw.
 func updateGameData(w http.ResponseWriter, r *http.Request) {
 	// Parse request Body
 	var requestBody map[string]interface{}
@@ -213,14 +194,35 @@ func updateGameData(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Identify the player from their session, never from the request body
+	userName, _ := auth.UserName(r)
+
 	// Extract values from request body
-	userName, _ := requestBody["userName"].(string)
-	hasDefuseCard, _ := requestBody["hasDefuseCard"].(bool)
 	activeCard, _ := requestBody["activeCard"].(string)
 	score, _ := strconv.Atoi(requestBody["score"].(string))
 
-	gameCards := requestBody["gameCards"].([]interface{})
-	gameCardsStr, _ := json.Marshal((gameCards))
+	if err := gameEngine.ValidateScore(userName, score); err != nil {
+		if errors.Is(err, engine.ErrScoreMismatch) {
+			http.Error(w, "Client score diverges from server state", http.StatusConflict)
+			return
+		}
+		http.Error(w, "Failed to validate game data", http.StatusInternalServerError)
+		return
+	}
+
+	// gameCards and hasDefuseCard stay server-authoritative: read them back
+	// from the engine instead of trusting whatever the client sent.
+	state, err := gameEngine.State(userName)
+	if err != nil {
+		http.Error(w, "Failed to load game data", http.StatusInternalServerError)
+		return
+	}
+	gameCardsStr, err := json.Marshal(state.GameCards)
+	if err != nil {
+		http.Error(w, "Failed to serialize game data", http.StatusInternalServerError)
+		return
+	}
+	hasDefuseCard := state.HasDefuseCard
 
 	// Update game data in Redis
 	ctx := context.Background()
@@ -258,13 +260,16 @@ func updateGameData(w http.ResponseWriter, r *http.Request) {
 	// Write the leaderboard JSON as the response
 	w.Write(leaderboardJSON)
 
+	// Emit the latest leaderboard to WebSocket clients
+	hub.Broadcast <- leaderboardJSON
+
 	// Send response
 	responseData := map[string]interface{}{
 		"userName":      userName,
 		"hadDefuseCard": hasDefuseCard,
 		"activeCard":    activeCard,
 		"score":         score,
-		"gameCards":     gameCards,
+		"gameCards":     state.GameCards,
 	}
 	json.NewEncoder(w).Encode(responseData)
 }
@@ -278,10 +283,10 @@ func resetGame(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract userName from request body
-	userName := requestBody["userName"]
+	// Identify the player from their session, never from the request body
+	userName, _ := auth.UserName(r)
 	if userName == "" {
-		http.Error(w, "Missing userName in request body", http.StatusBadRequest)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -320,20 +325,113 @@ func resetGame(w http.ResponseWriter, r *http.Request) {
 	w.Write(leaderboardJSON)
 
 	// Emit the latest leaderboard to WebSocket clients
-	broadcastLeaderboard <- leaderboardJSON
+	hub.Broadcast <- leaderboardJSON
+}
+
+// drawCardHandler handles POST /game/draw. The server draws the next card
+// from the player's server-side deck, applies its effect and returns the
+// resulting state, so the client never gets to invent a score.
+func drawCardHandler(w http.ResponseWriter, r *http.Request) {
+	// Identify the player from their session, never from the query param
+	userName, _ := auth.UserName(r)
+	if userName == "" {
+		http.Error(w, "Missing userName", http.StatusBadRequest)
+		return
+	}
+
+	card, state, err := gameEngine.DrawCard(userName)
+	if err != nil {
+		http.Error(w, "Failed to draw card: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Card  l.Card           `json:"card"`
+		State engine.GameState `json:"gameState"`
+	}{Card: card, State: state})
+}
+
+// playDefuseHandler handles POST /game/defuse.
+func playDefuseHandler(w http.ResponseWriter, r *http.Request) {
+	// Identify the player from their session, never from the query param
+	userName, _ := auth.UserName(r)
+	if userName == "" {
+		http.Error(w, "Missing userName", http.StatusBadRequest)
+		return
+	}
+
+	state, err := gameEngine.PlayDefuse(userName)
+	if err != nil {
+		http.Error(w, "Failed to play defuse: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// defaultPeekCards is how many cards the "See the Future" card reveals.
+const defaultPeekCards = 3
+
+// peekCardsHandler handles GET /game/peek?n=3, the "See the Future" card's
+// effect: it lets the caller look at the top of their deck without
+// drawing from it.
+func peekCardsHandler(w http.ResponseWriter, r *http.Request) {
+	// Identify the player from their session, never from the query param
+	userName, _ := auth.UserName(r)
+	if userName == "" {
+		http.Error(w, "Missing userName", http.StatusBadRequest)
+		return
+	}
+
+	n := defaultPeekCards
+	if v := r.URL.Query().Get("n"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid n", http.StatusBadRequest)
+			return
+		}
+		n = parsed
+	}
+
+	cards, err := gameEngine.PeekCards(userName, n)
+	if err != nil {
+		http.Error(w, "Failed to peek cards: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cards)
 }
 
 func main() {
+	// Start the websocket hub
+	go hub.Run()
+
 	// Initialize the Gorilla router
 	r := mux.NewRouter()
 
+	// Register account handlers
+	r.HandleFunc("/api/account/register", authSvc.Register).Methods("POST")
+	r.HandleFunc("/api/account/login", authSvc.Login).Methods("POST")
+	r.HandleFunc("/api/account/logout", authSvc.Logout).Methods("GET")
+
 	// Register API handlers
-	r.HandleFunc("/game", gameHandler).Methods("GET")
-	r.HandleFunc("/game", updateGameData).Methods("PUT")
-	r.HandleFunc("/game", resetGame).Methods("DELETE")
+	r.HandleFunc("/game", authSvc.Middleware(gameHandler)).Methods("GET")
+	r.HandleFunc("/game", authSvc.Middleware(updateGameData)).Methods("PUT")
+	r.HandleFunc("/game", authSvc.Middleware(resetGame)).Methods("DELETE")
+	r.HandleFunc("/game/draw", authSvc.Middleware(drawCardHandler)).Methods("POST")
+	r.HandleFunc("/game/defuse", authSvc.Middleware(playDefuseHandler)).Methods("POST")
+	r.HandleFunc("/game/peek", authSvc.Middleware(peekCardsHandler)).Methods("GET")
+
+	// Register multi-lobby API handlers, sharing the same Redis client and
+	// auth service as everything else instead of standing up their own.
+	lobbyController := lobby.NewController(rdb, authSvc)
+	lobbyController.RegisterRoutes(r)
 
 	// Register WebSocket handler
-	http.HandleFunc("/ws", websocketHandler)
+	r.HandleFunc("/ws", authSvc.Middleware(websocketHandler))
 
 	// Start the HTTP server
 	server := &http.Server{
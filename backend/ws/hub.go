@@ -0,0 +1,172 @@
+// Package ws implements the websocket fan-out used to push leaderboard
+// and game-state updates to every connected browser.
+package ws
+
+import (
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+	sendBuffer = 16
+)
+
+var upgrader = websocket.Upgrader{}
+
+// Client wraps a single websocket connection. Reads happen on readPump,
+// writes are serialized through send so writePump is the only goroutine
+// that ever calls conn.WriteMessage.
+type Client struct {
+	hub      *Hub
+	conn     *websocket.Conn
+	userName string
+	send     chan []byte
+}
+
+// Hub fans messages out to every registered Client.
+type Hub struct {
+	mu         sync.RWMutex
+	clients    map[*Client]bool
+	byUserName map[string]*Client
+
+	register   chan *Client
+	unregister chan *Client
+	Broadcast  chan []byte
+
+	// OnMessage, if set, is invoked with a client's userName each time a
+	// message is read off its connection.
+	OnMessage func(userName string, message []byte)
+}
+
+// NewHub returns an empty Hub. Call Run in its own goroutine to start
+// servicing it.
+func NewHub() *Hub {
+	return &Hub{
+		clients:    make(map[*Client]bool),
+		byUserName: make(map[string]*Client),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		Broadcast:  make(chan []byte),
+	}
+}
+
+// Run services register/unregister/broadcast until the process exits.
+func (h *Hub) Run() {
+	for {
+		select {
+		case c := <-h.register:
+			h.mu.Lock()
+			if _, taken := h.byUserName[c.userName]; taken {
+				// A duplicate connection request from a player who is
+				// already connected must not be allowed to tear down the
+				// live connection out from under them - reject the new
+				// one instead.
+				h.mu.Unlock()
+				log.Printf("ws: rejecting duplicate connection for %q", c.userName)
+				close(c.send)
+				c.conn.Close()
+				continue
+			}
+			h.clients[c] = true
+			h.byUserName[c.userName] = c
+			h.mu.Unlock()
+
+		case c := <-h.unregister:
+			h.mu.Lock()
+			if h.clients[c] {
+				delete(h.clients, c)
+				delete(h.byUserName, c.userName)
+				close(c.send)
+			}
+			h.mu.Unlock()
+
+		case msg := <-h.Broadcast:
+			h.mu.RLock()
+			for c := range h.clients {
+				select {
+				case c.send <- msg:
+				default:
+					// Slow consumer, drop it rather than block the hub.
+					go func(c *Client) { h.unregister <- c }(c)
+				}
+			}
+			h.mu.RUnlock()
+		}
+	}
+}
+
+// ServeWS upgrades r to a websocket connection for userName and starts
+// its read/write pumps. userName identifies the player (the server passes
+// the authenticated session's userName) so a reconnecting browser can be
+// recognized.
+func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request, userName string) error {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+
+	c := &Client{hub: h, conn: conn, userName: userName, send: make(chan []byte, sendBuffer)}
+	h.register <- c
+
+	go c.writePump()
+	go c.readPump()
+
+	return nil
+}
+
+func (c *Client) readPump() {
+	defer func() {
+		c.hub.unregister <- c
+	}()
+
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if c.hub.OnMessage != nil {
+			c.hub.OnMessage(c.userName, message)
+		}
+	}
+}
+
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
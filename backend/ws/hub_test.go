@@ -0,0 +1,87 @@
+package ws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialTestServer spins up an httptest.Server that hands every request to
+// h.ServeWS for userName and returns a dialed client connection to it.
+func dialTestServer(t *testing.T, h *Hub, userName string) (*websocket.Conn, *httptest.Server) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := h.ServeWS(w, r, userName); err != nil {
+			t.Errorf("ServeWS: %v", err)
+		}
+	}))
+
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	return conn, server
+}
+
+func TestHubBroadcastsToEveryClient(t *testing.T) {
+	h := NewHub()
+	go h.Run()
+
+	connA, serverA := dialTestServer(t, h, "alice")
+	defer serverA.Close()
+	defer connA.Close()
+	connB, serverB := dialTestServer(t, h, "bob")
+	defer serverB.Close()
+	defer connB.Close()
+
+	time.Sleep(50 * time.Millisecond) // let both registrations land before broadcasting
+
+	h.Broadcast <- []byte("hello")
+
+	for _, conn := range []*websocket.Conn{connA, connB} {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if string(msg) != "hello" {
+			t.Fatalf("got %q, want %q", msg, "hello")
+		}
+	}
+}
+
+func TestHubRejectsDuplicateUserName(t *testing.T) {
+	h := NewHub()
+	go h.Run()
+
+	connA, serverA := dialTestServer(t, h, "alice")
+	defer serverA.Close()
+	defer connA.Close()
+
+	time.Sleep(50 * time.Millisecond) // let the first registration land first
+
+	connB, serverB := dialTestServer(t, h, "alice")
+	defer serverB.Close()
+	defer connB.Close()
+
+	// The hub must reject the second connection for an already-connected
+	// userName, so reading from it should fail instead of ever delivering
+	// a broadcast.
+	connB.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := connB.ReadMessage(); err == nil {
+		t.Fatal("expected the duplicate connection to be closed by the hub")
+	}
+
+	// The original connection must be unaffected by the rejected duplicate.
+	h.Broadcast <- []byte("still here")
+	connA.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, msg, err := connA.ReadMessage(); err != nil || string(msg) != "still here" {
+		t.Fatalf("ReadMessage on the surviving connection: %v, %q", err, msg)
+	}
+}